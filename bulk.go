@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/vbha/tor-exit-nodes/policy"
+)
+
+// getBulkExitList serves the known-good exit node IPs as newline-delimited
+// plain text, matching the TorBulkExitList format used by
+// check.torproject.org and consumed directly by firewalls/fail2ban. When
+// ip= and port= are both given, only relays whose exit policy would permit a
+// connection to that destination are returned.
+func getBulkExitList(c *gin.Context) {
+	dstIP := c.Query("ip")
+	dstPortParam := c.Query("port")
+
+	var dstAddr netip.Addr
+	var dstPort int
+	filterByPolicy := dstIP != "" && dstPortParam != ""
+	if filterByPolicy {
+		var err error
+		dstAddr, err = netip.ParseAddr(dstIP)
+		if err != nil {
+			c.String(http.StatusBadRequest, "invalid ip parameter\n")
+			return
+		}
+		dstPort, err = strconv.Atoi(dstPortParam)
+		if err != nil {
+			c.String(http.StatusBadRequest, "invalid port parameter\n")
+			return
+		}
+	}
+
+	var nodes []TorExitNode
+	if err := db.Find(&nodes).Error; err != nil {
+		c.String(http.StatusInternalServerError, "%s\n", err.Error())
+		return
+	}
+
+	// Same allowlist exclusion as the JSON endpoint: load the CIDRs once and
+	// filter in-process rather than a SQL subquery, since the allowlist is
+	// no longer a column of exact IPs.
+	allowed, err := loadPrefixes(&Allowlist{})
+	if err != nil {
+		c.String(http.StatusInternalServerError, "%s\n", err.Error())
+		return
+	}
+
+	var b strings.Builder
+	for _, node := range nodes {
+		addr, err := netip.ParseAddr(node.IPAddress)
+		if err != nil || containsAddr(allowed, addr) {
+			continue
+		}
+		if filterByPolicy {
+			rules, defaultAccept, err := policy.Parse(node.ExitPolicySummary)
+			if err != nil || !policy.Allows(rules, defaultAccept, dstAddr, dstPort) {
+				continue
+			}
+		}
+		fmt.Fprintln(&b, node.IPAddress)
+	}
+
+	c.String(http.StatusOK, b.String())
+}
@@ -0,0 +1,134 @@
+// Package geoip resolves IP addresses against local MaxMind GeoLite2 .mmdb
+// files, replacing the ipinfo.io network hop the server used to make per-IP.
+package geoip
+
+import (
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// DB holds the three GeoLite2 readers and reloads them whenever the
+// underlying file on disk changes, so operators can drop in a fresh
+// database without restarting the server.
+type DB struct {
+	countryPath, cityPath, asnPath string
+
+	mu      sync.RWMutex
+	country *maxminddb.Reader
+	city    *maxminddb.Reader
+	asn     *maxminddb.Reader
+
+	countryModTime, cityModTime, asnModTime int64
+}
+
+// Open opens the GeoLite2-Country, GeoLite2-City, and GeoLite2-ASN databases
+// at the given paths. It returns an error if any of them are missing or
+// unreadable, since silently degrading would just fill the database with
+// blank geo columns.
+func Open(countryPath, cityPath, asnPath string) (*DB, error) {
+	db := &DB{countryPath: countryPath, cityPath: cityPath, asnPath: asnPath}
+	if err := db.reload(); err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
+func (d *DB) reload() error {
+	// Snapshot the last-seen modtimes under the lock: Lookup calls reload on
+	// every invocation from up to EnrichmentWorkers concurrent goroutines, so
+	// reading these fields unlocked would race with the writes below.
+	d.mu.RLock()
+	lastCountryModTime, lastCityModTime, lastASNModTime := d.countryModTime, d.cityModTime, d.asnModTime
+	d.mu.RUnlock()
+
+	country, countryModTime, err := openIfChanged(d.countryPath, lastCountryModTime)
+	if err != nil {
+		return fmt.Errorf("opening GeoLite2-Country database %q: %w", d.countryPath, err)
+	}
+	city, cityModTime, err := openIfChanged(d.cityPath, lastCityModTime)
+	if err != nil {
+		return fmt.Errorf("opening GeoLite2-City database %q: %w", d.cityPath, err)
+	}
+	asn, asnModTime, err := openIfChanged(d.asnPath, lastASNModTime)
+	if err != nil {
+		return fmt.Errorf("opening GeoLite2-ASN database %q: %w", d.asnPath, err)
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if country != nil {
+		d.country, d.countryModTime = country, countryModTime
+	}
+	if city != nil {
+		d.city, d.cityModTime = city, cityModTime
+	}
+	if asn != nil {
+		d.asn, d.asnModTime = asn, asnModTime
+	}
+	return nil
+}
+
+// openIfChanged reopens path if its mtime differs from lastModTime. It returns
+// a nil reader (and no error) when the file is unchanged.
+func openIfChanged(path string, lastModTime int64) (*maxminddb.Reader, int64, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	modTime := info.ModTime().UnixNano()
+	if modTime == lastModTime {
+		return nil, lastModTime, nil
+	}
+	reader, err := maxminddb.Open(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	return reader, modTime, nil
+}
+
+type countryRecord struct {
+	Country struct {
+		IsoCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+}
+
+type cityRecord struct {
+	City struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"city"`
+}
+
+type asnRecord struct {
+	AutonomousSystemNumber       uint   `maxminddb:"autonomous_system_number"`
+	AutonomousSystemOrganization string `maxminddb:"autonomous_system_organization"`
+}
+
+// Lookup resolves an IP to its country ISO code, English city name, ASN, and
+// AS organization name. Any of these may come back empty if the database has
+// no entry for the address.
+func (d *DB) Lookup(ip string) (country, city string, asn uint, asName string, err error) {
+	if reloadErr := d.reload(); reloadErr != nil {
+		return "", "", 0, "", reloadErr
+	}
+
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	var cRec countryRecord
+	if err := d.country.LookupString(ip, &cRec); err != nil {
+		return "", "", 0, "", fmt.Errorf("country lookup for %q: %w", ip, err)
+	}
+	var cityRec cityRecord
+	if err := d.city.LookupString(ip, &cityRec); err != nil {
+		return "", "", 0, "", fmt.Errorf("city lookup for %q: %w", ip, err)
+	}
+	var aRec asnRecord
+	if err := d.asn.LookupString(ip, &aRec); err != nil {
+		return "", "", 0, "", fmt.Errorf("asn lookup for %q: %w", ip, err)
+	}
+
+	return cRec.Country.IsoCode, cityRec.City.Names["en"], aRec.AutonomousSystemNumber, aRec.AutonomousSystemOrganization, nil
+}
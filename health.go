@@ -0,0 +1,48 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// getHealthz is a liveness probe: the process is up and can describe its
+// own state, regardless of whether a fetch has ever succeeded.
+func getHealthz(c *gin.Context) {
+	lastFetchMu.RLock()
+	lastFetch := lastFetchSuccess
+	lastFetchMu.RUnlock()
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":             "ok",
+		"queue_depth":        enrichmentPool.QueueDepth(),
+		"saturated":          enrichmentPool.Saturated(),
+		"last_fetch_success": lastFetch,
+	})
+}
+
+// getReadyz is a readiness probe: only report ready once we've completed at
+// least one fetch cycle, so a load balancer doesn't send traffic to an
+// instance with a stale/empty database. A saturated enrichment pool is
+// reported but doesn't affect readiness — a ~1500-relay fetch saturating
+// the queue is normal load, not unreadiness.
+func getReadyz(c *gin.Context) {
+	lastFetchMu.RLock()
+	lastFetch := lastFetchSuccess
+	lastFetchMu.RUnlock()
+
+	ready := !lastFetch.IsZero()
+	status := http.StatusOK
+	if !ready {
+		status = http.StatusServiceUnavailable
+	}
+
+	c.JSON(status, gin.H{
+		"ready":              ready,
+		"queue_depth":        enrichmentPool.QueueDepth(),
+		"saturated":          enrichmentPool.Saturated(),
+		"last_fetch_success": lastFetch,
+		"since":              time.Since(lastFetch).String(),
+	})
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// normalizeCIDR accepts either a bare IP ("1.2.3.4") or a CIDR
+// ("1.2.3.4/32", "2001:db8::/32") and returns the canonical prefix string,
+// treating a bare IP as a single-address prefix.
+func normalizeCIDR(s string) (string, error) {
+	if prefix, err := netip.ParsePrefix(s); err == nil {
+		return prefix.String(), nil
+	}
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return "", err
+	}
+	bits := 32
+	if addr.Is6() {
+		bits = 128
+	}
+	return netip.PrefixFrom(addr, bits).String(), nil
+}
+
+// loadPrefixes reads every CIDR row out of a (dis)allow list table into
+// parsed netip.Prefix values, for in-process Contains checks.
+func loadPrefixes(model interface{ TableName() string }) ([]netip.Prefix, error) {
+	var rows []struct{ CIDR string }
+	if err := db.Table(model.TableName()).Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	prefixes := make([]netip.Prefix, 0, len(rows))
+	for _, row := range rows {
+		prefix, err := netip.ParsePrefix(row.CIDR)
+		if err != nil {
+			continue
+		}
+		prefixes = append(prefixes, prefix)
+	}
+	return prefixes, nil
+}
+
+// TableName lets loadPrefixes work off of either list without needing a
+// shared struct definition.
+func (Allowlist) TableName() string { return "allowlists" }
+func (Denylist) TableName() string  { return "denylists" }
+
+func containsAddr(prefixes []netip.Prefix, addr netip.Addr) bool {
+	for _, prefix := range prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+func addToAllowlist(c *gin.Context) {
+	addToList(c, "allowlist", func(cidr string) error {
+		return db.Create(&Allowlist{CIDR: cidr}).Error
+	})
+}
+
+func removeFromAllowlist(c *gin.Context) {
+	removeFromList(c, "allowlist", func(cidr string) error {
+		return db.Where("cidr = ?", cidr).Delete(&Allowlist{}).Error
+	})
+}
+
+func getAllowlist(c *gin.Context) {
+	var entries []Allowlist
+	db.Find(&entries)
+	cidrs := make([]string, len(entries))
+	for i, entry := range entries {
+		cidrs[i] = entry.CIDR
+	}
+	c.JSON(http.StatusOK, gin.H{"allowlist": cidrs})
+}
+
+func addToDenylist(c *gin.Context) {
+	addToList(c, "denylist", func(cidr string) error {
+		return db.Create(&Denylist{CIDR: cidr}).Error
+	})
+}
+
+func removeFromDenylist(c *gin.Context) {
+	removeFromList(c, "denylist", func(cidr string) error {
+		return db.Where("cidr = ?", cidr).Delete(&Denylist{}).Error
+	})
+}
+
+func getDenylist(c *gin.Context) {
+	var entries []Denylist
+	db.Find(&entries)
+	cidrs := make([]string, len(entries))
+	for i, entry := range entries {
+		cidrs[i] = entry.CIDR
+	}
+	c.JSON(http.StatusOK, gin.H{"denylist": cidrs})
+}
+
+// addToList binds the usual {"cidrs": [...]} request body, validates and
+// normalizes each entry, inserts it via create, and records an audit event.
+func addToList(c *gin.Context, kind string, create func(cidr string) error) {
+	var req struct {
+		CIDRs []string `json:"cidrs"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var added []string
+	for _, entry := range req.CIDRs {
+		cidr, err := normalizeCIDR(entry)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid CIDR " + entry})
+			return
+		}
+		if err := create(cidr); err == nil {
+			added = append(added, cidr)
+		}
+	}
+	recordEvent(kind+".add", c.ClientIP(), gin.H{"cidrs": added})
+	c.JSON(http.StatusOK, gin.H{"message": "CIDRs added to the " + kind})
+}
+
+func removeFromList(c *gin.Context, kind string, remove func(cidr string) error) {
+	var req struct {
+		CIDRs []string `json:"cidrs"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var removed []string
+	for _, entry := range req.CIDRs {
+		cidr, err := normalizeCIDR(entry)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid CIDR " + entry})
+			return
+		}
+		if err := remove(cidr); err == nil {
+			removed = append(removed, cidr)
+		}
+	}
+	recordEvent(kind+".remove", c.ClientIP(), gin.H{"cidrs": removed})
+	c.JSON(http.StatusOK, gin.H{"message": "CIDRs removed from the " + kind})
+}
+
+// recordEvent appends one row to the audit log. Failures are logged, not
+// propagated, so a broken audit log never blocks the mutation it's recording.
+func recordEvent(kind, actor string, payload gin.H) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		fmt.Println("Error encoding audit event:", err)
+		return
+	}
+	if err := db.Create(&Event{
+		Kind:      kind,
+		Actor:     actor,
+		Payload:   string(data),
+		CreatedAt: time.Now(),
+	}).Error; err != nil {
+		fmt.Println("Error recording audit event:", err)
+	}
+}
+
+func getEvents(c *gin.Context) {
+	since := c.Query("since")
+
+	query := db.Model(&Event{})
+	if since != "" {
+		sinceTime, err := time.Parse(time.RFC3339, since)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid since format"})
+			return
+		}
+		query = query.Where("created_at > ?", sinceTime)
+	}
+
+	var events []Event
+	query.Order("created_at").Find(&events)
+	c.JSON(http.StatusOK, gin.H{"events": events})
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"net/netip"
+	"testing"
+)
+
+func TestNormalizeCIDR(t *testing.T) {
+	cases := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{in: "10.0.0.0/8", want: "10.0.0.0/8"},
+		{in: "2001:db8::/32", want: "2001:db8::/32"},
+		{in: "1.2.3.4", want: "1.2.3.4/32"},
+		{in: "::1", want: "::1/128"},
+		{in: "not-an-ip", wantErr: true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.in, func(t *testing.T) {
+			got, err := normalizeCIDR(tc.in)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("normalizeCIDR(%q) = %q, want error", tc.in, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("normalizeCIDR(%q) returned error: %v", tc.in, err)
+			}
+			if got != tc.want {
+				t.Errorf("normalizeCIDR(%q) = %q, want %q", tc.in, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestContainsAddr(t *testing.T) {
+	prefixes := []netip.Prefix{
+		netip.MustParsePrefix("10.0.0.0/8"),
+		netip.MustParsePrefix("192.168.1.1/32"),
+	}
+
+	cases := []struct {
+		addr string
+		want bool
+	}{
+		{addr: "10.1.2.3", want: true},
+		{addr: "192.168.1.1", want: true},
+		{addr: "192.168.1.2", want: false},
+		{addr: "8.8.8.8", want: false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.addr, func(t *testing.T) {
+			addr := netip.MustParseAddr(tc.addr)
+			if got := containsAddr(prefixes, addr); got != tc.want {
+				t.Errorf("containsAddr(%q) = %v, want %v", tc.addr, got, tc.want)
+			}
+		})
+	}
+}
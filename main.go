@@ -1,193 +1,391 @@
 package main
 
 import (
-	"bufio"
+	"context"
+	"flag"
 	"fmt"
-	"io/ioutil"
+	"net"
 	"net/http"
+	"net/netip"
+	"os"
+	"os/signal"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
+
+	"github.com/vbha/tor-exit-nodes/geoip"
+	"github.com/vbha/tor-exit-nodes/retention"
+	"github.com/vbha/tor-exit-nodes/torclient"
+	"github.com/vbha/tor-exit-nodes/workerpool"
+)
+
+var (
+	viaTor   = flag.Bool("via-tor", false, "fetch the exit-node source feed over Tor instead of the clearnet")
+	torSocks = flag.String("tor-socks", "", "external SOCKS5 proxy to use when --via-tor is set (e.g. 127.0.0.1:9050); if empty, an embedded Tor instance is started")
 )
 
 // TorExitNode represents the model for Tor exit-node information
 type TorExitNode struct {
-	ID        uint   `gorm:"primaryKey"`
-	IPAddress string `gorm:"unique"`
-	Country   string
-	Timestamp time.Time
+	ID uint `gorm:"primaryKey"`
+	// Not unique: Tor permits more than one relay per IP, so two distinct
+	// fingerprints can legitimately share an address. Fingerprint is the
+	// identity key.
+	IPAddress         string
+	Country           string
+	City              string
+	ASN               uint
+	ASName            string
+	Fingerprint       string `gorm:"unique"`
+	Nickname          string
+	ORPort            int
+	ExitPolicySummary string
+	Flags             string
+	Hostname          string
+	Timestamp         time.Time
+	FirstSeen         time.Time
+	LastSeen          time.Time
+	DeletedAt         gorm.DeletedAt `gorm:"index"`
+}
+
+// RelayRecord is what an exitNodeSource hands back for a single relay before
+// it's merged into a TorExitNode row.
+type RelayRecord struct {
+	IPAddress         string
+	Fingerprint       string
+	Nickname          string
+	ORPort            int
+	ExitPolicySummary string
+	Flags             string
 }
 
-// (dis)allow list structure
+// exitNodeSource is implemented by anything that can produce a current list
+// of Tor exit relays, so the fetch pipeline isn't tied to one upstream feed.
+type exitNodeSource interface {
+	FetchExitNodes() ([]RelayRecord, error)
+}
+
+// Allowlist holds CIDR ranges (or bare IPs, stored as /32 or /128) that are
+// excluded from the public exit-node list.
 type Allowlist struct {
+	ID   uint   `gorm:"primaryKey"`
+	CIDR string `gorm:"unique"`
+}
+
+// Denylist holds CIDR ranges that should be flagged, surfaced via
+// ?mode=denylisted-only on /tor-exit-nodes.
+type Denylist struct {
+	ID   uint   `gorm:"primaryKey"`
+	CIDR string `gorm:"unique"`
+}
+
+// Event records one allowlist/denylist mutation for audit purposes.
+type Event struct {
 	ID        uint   `gorm:"primaryKey"`
-	IPAddress string `gorm:"unique"`
+	Kind      string
+	Actor     string
+	Payload   string `gorm:"type:json"`
+	CreatedAt time.Time
 }
 
 var db *gorm.DB
 var torExitNodes []TorExitNode
+var nodeSource exitNodeSource = newOnionooSource()
+var geoDB *geoip.DB
+var retentionManager *retention.Manager
+var enrichmentPool *workerpool.Pool
+var lastFetchSuccess time.Time
+var lastFetchMu sync.RWMutex
 
 func main() {
+	flag.Parse()
 	r := gin.Default()
 
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
 	initDatabase()
-	go fetchTorExitNodesPeriodically()
+	initGeoIP()
+	initRetention()
+	initWorkerPool(ctx)
+	initTorClient(ctx)
+	go fetchTorExitNodesPeriodically(ctx)
 
 	// API endpoints to get and modify the allow list
 	r.POST("/allowlist", addToAllowlist)
 	r.DELETE("/allowlist", removeFromAllowlist)
 	r.GET("/allowlist", getAllowlist)
 
+	// API endpoints to get and modify the deny list
+	r.POST("/denylist", addToDenylist)
+	r.DELETE("/denylist", removeFromDenylist)
+	r.GET("/denylist", getDenylist)
+
+	// Audit log of allowlist/denylist mutations
+	r.GET("/events", getEvents)
+
 	// API endpoint for aggregated list of exit node addresses
 	r.GET("/tor-exit-nodes", getTorExitNodes)
 
-	r.Run(":8080")
+	// Inspect and adjust the retention policy at runtime
+	r.GET("/retention", getRetentionPolicy)
+	r.PUT("/retention", updateRetentionPolicy)
+
+	// Plain-text bulk list endpoints, compatible with the Tor project's own
+	// check.torproject.org bulk exit list
+	r.GET("/torbulkexitlist", getBulkExitList)
+	r.GET("/api/bulk", getBulkExitList)
+
+	// Liveness/readiness, useful behind a load balancer
+	r.GET("/healthz", getHealthz)
+	r.GET("/readyz", getReadyz)
+
+	srv := &http.Server{Addr: ":8080", Handler: r}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer shutdownCancel()
+		srv.Shutdown(shutdownCtx)
+	}()
+
+	if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		fmt.Println("Server error:", err)
+		os.Exit(1)
+	}
 }
 
-func addToAllowlist(c *gin.Context) {
-	// Bind JSON request body to struct
-	var req struct {
-		IPAddresses []string `json:"ip_addresses"`
+func initDatabase() {
+	// Open a SQLite database connection
+	database, err := gorm.Open(sqlite.Open("tor_exit_nodes.db"), &gorm.Config{})
+	if err != nil {
+		panic("Failed to connect to database")
 	}
+	// Auto-migrate all models
+	database.AutoMigrate(&TorExitNode{}, &Allowlist{}, &Denylist{}, &Event{})
+	// Our global db variable is called db
+	db = database
+}
 
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		return
-	}
+func initGeoIP() {
+	// Paths to the GeoLite2 databases, overridable for deployments that keep
+	// them somewhere other than the working directory
+	countryPath := envOrDefault("GEOIP_COUNTRY_DB", "GeoLite2-Country.mmdb")
+	cityPath := envOrDefault("GEOIP_CITY_DB", "GeoLite2-City.mmdb")
+	asnPath := envOrDefault("GEOIP_ASN_DB", "GeoLite2-ASN.mmdb")
 
-	for _, ip := range req.IPAddresses {
-		var existingEntry Allowlist
-		result := db.Where("ip_address = ?", ip).First(&existingEntry)
-		// Make sure the address isn't already there before adding
-		if result.Error != nil && result.Error == gorm.ErrRecordNotFound {
-			allowlistEntry := Allowlist{IPAddress: ip}
-			db.Create(&allowlistEntry)
-		}
+	db, err := geoip.Open(countryPath, cityPath, asnPath)
+	if err != nil {
+		// Fail loudly rather than silently filling the database with blanks
+		panic(fmt.Sprintf("Failed to open GeoIP databases: %v", err))
 	}
+	geoDB = db
+}
 
-	c.JSON(http.StatusOK, gin.H{"message": "IP addresses added to the allowlist"})
+func envOrDefault(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
 }
 
-func removeFromAllowlist(c *gin.Context) {
-	// Bind JSON request body to struct
-	var req struct {
-		IPAddresses []string `json:"ip_addresses"`
+func initRetention() {
+	ttl, err := time.ParseDuration(envOrDefault("ExitNodeTTL", "24h"))
+	if err != nil {
+		panic(fmt.Sprintf("Invalid ExitNodeTTL: %v", err))
 	}
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		return
+	sweepInterval, err := time.ParseDuration(envOrDefault("ExitNodeSweepInterval", "15m"))
+	if err != nil {
+		panic(fmt.Sprintf("Invalid ExitNodeSweepInterval: %v", err))
 	}
 
-	for _, ip := range req.IPAddresses {
-		var existingEntry Allowlist
-		result := db.Where("ip_address = ?", ip).First(&existingEntry)
-		// Make sure the address is there before removing
-		if result.Error == nil {
-			db.Delete(&existingEntry)
-		}
-	}
-	c.JSON(http.StatusOK, gin.H{"message": "IP addresses removed from the allowlist"})
+	retentionManager = retention.NewManager(db, &TorExitNode{}, retention.Policy{
+		TTL:           ttl,
+		SweepInterval: sweepInterval,
+		HardDelete:    true,
+	})
+	retentionManager.Start()
 }
 
-func getAllowlist(c *gin.Context) {
-	var entries []Allowlist
-	db.Find(&entries)
-	ipAddresses := make([]string, len(entries))
-	for i, entry := range entries {
-		ipAddresses[i] = entry.IPAddress
+func initWorkerPool(ctx context.Context) {
+	workers := 16
+	if raw := os.Getenv("EnrichmentWorkers"); raw != "" {
+		if parsed, err := strconv.Atoi(raw); err == nil && parsed > 0 {
+			workers = parsed
+		}
 	}
-	c.JSON(http.StatusOK, gin.H{"allowlist": ipAddresses})
+
+	enrichmentPool = workerpool.New(workers, workers*4)
+	enrichmentPool.Start(ctx)
+
+	// SIGINT cancels ctx, which stops in-flight workers immediately; this
+	// just drains whatever was already picked up so Shutdown returns
+	go func() {
+		<-ctx.Done()
+		enrichmentPool.Shutdown()
+	}()
 }
 
-func initDatabase() {
-	// Open a SQLite database connection
-	database, err := gorm.Open(sqlite.Open("tor_exit_nodes.db"), &gorm.Config{})
+func initTorClient(ctx context.Context) {
+	provider := torclient.New(torclient.Config{
+		ViaTor:           *viaTor,
+		SocksAddr:        *torSocks,
+		BootstrapTimeout: 2 * time.Minute,
+	})
+
+	client, err := provider.Client(ctx)
 	if err != nil {
-		panic("Failed to connect to database")
+		fmt.Println("Error setting up Tor client, falling back to direct HTTP:", err)
+		return
+	}
+
+	if source, ok := nodeSource.(*onionooSource); ok {
+		source.SetClient(client)
 	}
-	// Auto-migrate both models
-	database.AutoMigrate(&TorExitNode{}, &Allowlist{})
-	// Our global db variable is called db
-	db = database
 }
 
-func fetchTorExitNodesPeriodically() {
+func fetchTorExitNodesPeriodically(ctx context.Context) {
 	// Our source says every half hour but let's do every hour to be safe
 	ticker := time.NewTicker(1 * time.Hour)
+	defer ticker.Stop()
 	// Initial fetch on startup
-	fetchTorExitNodes()
-	for range ticker.C {
-		fetchTorExitNodes()
+	fetchTorExitNodes(ctx)
+	for {
+		select {
+		case <-ticker.C:
+			fetchTorExitNodes(ctx)
+		case <-ctx.Done():
+			return
+		}
 	}
 }
 
-func fetchTorExitNodes() {
-	// Fetch Tor exit-node IPs from the source URL
-	url := "https://www.dan.me.uk/torlist/?exit"
-	resp, err := http.Get(url)
+func fetchTorExitNodes(ctx context.Context) {
+	// Fetch the current exit-relay set from whichever source is configured
+	records, err := nodeSource.FetchExitNodes()
 	if err != nil {
 		fmt.Println("Error fetching Tor exit nodes:", err)
 		return
 	}
-	defer resp.Body.Close()
-
-	scanner := bufio.NewScanner(resp.Body)
-	var ips []string
-	for scanner.Scan() {
-		ips = append(ips, scanner.Text())
-	}
-	saveToDatabase(ips)
+	saveToDatabase(ctx, records)
 
+	lastFetchMu.Lock()
+	lastFetchSuccess = time.Now()
+	lastFetchMu.Unlock()
 }
 
-func saveToDatabase(ips []string) {
-	// Takes in an array of ip addresses and saves them to the database
-	// Since we get all these nodes at the same time, we want to make sure they have the same timestamp
+// saveToDatabase takes in the relays observed in one fetch cycle. New relays
+// are enriched (GeoIP + reverse DNS) in parallel across the worker pool and
+// inserted in batches; relays we already know about get their mutable
+// descriptor fields (and LastSeen) refreshed in place.
+func saveToDatabase(ctx context.Context, records []RelayRecord) {
 	currentTime := time.Now()
-	for _, ip := range ips {
+
+	var mu sync.Mutex
+	var newNodes []TorExitNode
+	var wg sync.WaitGroup
+
+	for _, record := range records {
+		record := record
 		var existingNode TorExitNode
-		result := db.Where("ip_address = ?", ip).First(&existingNode)
+		// Unscoped: a relay that left the consensus and got soft-deleted by
+		// the retention sweeper must still be found here so it's restored
+		// instead of hitting the Fingerprint unique index on insert.
+		result := db.Unscoped().Where("fingerprint = ?", record.Fingerprint).First(&existingNode)
 
-		// If the IP doesn't already exist, create a new record
 		if result.Error != nil && result.Error == gorm.ErrRecordNotFound {
-			country, err := getCountryFromIP(ip)
-			if err != nil {
-				fmt.Printf("Error getting country for IP %s: %v\n", ip, err)
-				continue
+			wg.Add(1)
+			submitted := enrichmentPool.Submit(func(ctx context.Context) {
+				defer wg.Done()
+				node, err := enrichRelay(ctx, record, currentTime)
+				if err != nil {
+					fmt.Printf("Error enriching relay %s: %v\n", record.IPAddress, err)
+					return
+				}
+				mu.Lock()
+				newNodes = append(newNodes, node)
+				mu.Unlock()
+			})
+			if !submitted {
+				// Pool is shutting down (SIGINT); drop this relay rather
+				// than submit to a closed queue. It'll be picked up on the
+				// next fetch after restart.
+				wg.Done()
 			}
-
-			// Trim the country string otherwise it shows up as "US\n" instead of "US"
-			country = strings.TrimSpace(country)
-			node := TorExitNode{
-				IPAddress: ip,
-				Country:   country,
-				Timestamp: currentTime,
+		} else if result.Error == nil {
+			// Still in the consensus (or rejoined after being swept): refresh
+			// every field that can change between fetches, not just
+			// LastSeen, and clear any soft-delete from a previous sweep.
+			updates := map[string]interface{}{
+				"ip_address":          record.IPAddress,
+				"nickname":            record.Nickname,
+				"or_port":             record.ORPort,
+				"exit_policy_summary": record.ExitPolicySummary,
+				"flags":               record.Flags,
+				"last_seen":           currentTime,
+			}
+			if existingNode.DeletedAt.Valid {
+				updates["deleted_at"] = nil
 			}
-			db.Create(&node)
+			db.Unscoped().Model(&existingNode).Updates(updates)
 		}
 	}
-}
 
-func getCountryFromIP(ip string) (string, error) {
-	// Query ipinfo.io API for country information
-	// TODO: Find a different way to do this, ipinfo complains about too many requests
-	url := fmt.Sprintf("https://ipinfo.io/%s/country", ip)
-	resp, err := http.Get(url)
-	if err != nil {
-		return "", err
+	// A worker that observes ctx cancellation mid-run abandons whatever's
+	// still queued behind it, so those jobs' deferred wg.Done never fires.
+	// Wait on a done channel instead of wg directly so that case can't block
+	// this fetch cycle forever.
+	waitDone := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(waitDone)
+	}()
+	select {
+	case <-waitDone:
+	case <-ctx.Done():
 	}
-	defer resp.Body.Close()
 
-	country, err := ioutil.ReadAll(resp.Body)
+	if len(newNodes) > 0 {
+		db.CreateInBatches(&newNodes, 100)
+	}
+}
+
+// enrichRelay performs the network-touching lookups for a single new relay.
+func enrichRelay(ctx context.Context, record RelayRecord, observedAt time.Time) (TorExitNode, error) {
+	country, city, asn, asName, err := geoDB.Lookup(record.IPAddress)
 	if err != nil {
-		return "", err
+		return TorExitNode{}, err
 	}
 
-	return string(country), nil
+	return TorExitNode{
+		IPAddress:         record.IPAddress,
+		Country:           country,
+		City:              city,
+		ASN:               asn,
+		ASName:            asName,
+		Hostname:          reverseDNSLookup(ctx, record.IPAddress),
+		Fingerprint:       record.Fingerprint,
+		Nickname:          record.Nickname,
+		ORPort:            record.ORPort,
+		ExitPolicySummary: record.ExitPolicySummary,
+		Flags:             record.Flags,
+		Timestamp:         observedAt,
+		FirstSeen:         observedAt,
+		LastSeen:          observedAt,
+	}, nil
+}
+
+// reverseDNSLookup resolves an IP's PTR record, best-effort; an unresolvable
+// IP (the common case for Tor relays) just gets an empty hostname.
+func reverseDNSLookup(ctx context.Context, ip string) string {
+	names, err := net.DefaultResolver.LookupAddr(ctx, ip)
+	if err != nil || len(names) == 0 {
+		return ""
+	}
+	return strings.TrimSuffix(names[0], ".")
 }
 
 func getTorExitNodes(c *gin.Context) {
@@ -201,12 +399,44 @@ func getTorExitNodes(c *gin.Context) {
 	timeAddedStart := c.Query("starttime")
 	timeAddedEnd := c.Query("endtime")
 	pagination := c.Query("count")
-
-	// Before accounting for parameters, we throw out everything in the (dis)allowlist
-	query := db.Not("ip_address IN (?)", db.Table("allowlists").Select("ip_address"))
+	fingerprint := c.Query("fingerprint")
+	flag := c.Query("flag")
+	city := c.Query("city")
+	asn := c.Query("asn")
+	asName := c.Query("asname")
+	freshness := c.Query("freshness")
+	mode := c.Query("mode")
+
+	query := db.Model(&TorExitNode{})
 	if country != "" {
 		query = query.Where("country = ?", country)
 	}
+	if fingerprint != "" {
+		query = query.Where("fingerprint = ?", fingerprint)
+	}
+	if flag != "" {
+		// Flags is stored as a comma-joined list; pad it with delimiters at
+		// query time so the LIKE match can't straddle two flag names (a
+		// plain "%Exit%" would also match "BadExit").
+		query = query.Where("',' || flags || ',' LIKE ?", "%,"+flag+",%")
+	}
+	if city != "" {
+		query = query.Where("city = ?", city)
+	}
+	if asn != "" {
+		query = query.Where("asn = ?", asn)
+	}
+	if asName != "" {
+		query = query.Where("as_name = ?", asName)
+	}
+	if freshness != "" {
+		window, err := time.ParseDuration(freshness)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid freshness duration"})
+			return
+		}
+		query = query.Where("last_seen > ?", time.Now().Add(-window))
+	}
 	if timeAddedStart != "" {
 		startTime, err := time.Parse(time.RFC3339, timeAddedStart)
 		if err != nil {
@@ -227,6 +457,35 @@ func getTorExitNodes(c *gin.Context) {
 	var nodes []TorExitNode
 	query.Find(&nodes)
 
+	// Filter against the allow/deny lists in-process, since they're CIDRs
+	// rather than exact IPs and SQL has no good way to express "contains".
+	allowed, err := loadPrefixes(&Allowlist{})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	denied, err := loadPrefixes(&Denylist{})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var filtered []TorExitNode
+	for _, node := range nodes {
+		addr, err := netip.ParseAddr(node.IPAddress)
+		if err != nil {
+			continue
+		}
+		if containsAddr(allowed, addr) {
+			continue
+		}
+		if mode == "denylisted-only" && !containsAddr(denied, addr) {
+			continue
+		}
+		filtered = append(filtered, node)
+	}
+	nodes = filtered
+
 	var paginationInt int
 	if pagination != "" {
 		var err error
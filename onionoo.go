@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// onionooDetailsURL is the Tor Project's "details" document, filtered down to
+// running exit relays. See https://metrics.torproject.org/onionoo.html#details
+const onionooDetailsURL = "https://onionoo.torproject.org/details?flags=Exit&running=true"
+
+// onionooDocument is the subset of the Onionoo details response we care about.
+type onionooDocument struct {
+	Relays []onionooRelay `json:"relays"`
+}
+
+type onionooRelay struct {
+	Nickname          string              `json:"nickname"`
+	Fingerprint       string              `json:"fingerprint"`
+	ORAddresses       []string            `json:"or_addresses"`
+	Flags             []string            `json:"flags"`
+	ExitPolicySummary map[string][]string `json:"exit_policy_summary"`
+	Running           bool                `json:"running"`
+}
+
+// onionooSource is an exitNodeSource backed by the Onionoo details document.
+type onionooSource struct {
+	url        string
+	httpClient *http.Client
+}
+
+func newOnionooSource() *onionooSource {
+	return &onionooSource{url: onionooDetailsURL, httpClient: http.DefaultClient}
+}
+
+// SetClient swaps in a different HTTP client, e.g. one routed over Tor.
+func (s *onionooSource) SetClient(client *http.Client) {
+	s.httpClient = client
+}
+
+func (s *onionooSource) FetchExitNodes() ([]RelayRecord, error) {
+	resp, err := s.httpClient.Get(s.url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var doc onionooDocument
+	if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("decoding onionoo details document: %w", err)
+	}
+
+	var records []RelayRecord
+	for _, relay := range doc.Relays {
+		if !relay.Running {
+			continue
+		}
+		ip, orPort, err := splitORAddress(relay.ORAddresses)
+		if err != nil {
+			continue
+		}
+		records = append(records, RelayRecord{
+			IPAddress:         ip,
+			Fingerprint:       relay.Fingerprint,
+			Nickname:          relay.Nickname,
+			ORPort:            orPort,
+			ExitPolicySummary: summarizeExitPolicy(relay.ExitPolicySummary),
+			Flags:             strings.Join(relay.Flags, ","),
+		})
+	}
+	return records, nil
+}
+
+// splitORAddress picks the first usable "ip:port" entry out of a relay's
+// or_addresses list (Onionoo lists IPv4 first, then any IPv6 addresses).
+func splitORAddress(addrs []string) (string, int, error) {
+	if len(addrs) == 0 {
+		return "", 0, fmt.Errorf("relay has no or_addresses")
+	}
+	var lastErr error
+	for _, addr := range addrs {
+		idx := strings.LastIndex(addr, ":")
+		if idx == -1 {
+			lastErr = fmt.Errorf("malformed or_address %q", addr)
+			continue
+		}
+		ip := strings.Trim(addr[:idx], "[]")
+		port, err := strconv.Atoi(addr[idx+1:])
+		if err != nil {
+			lastErr = fmt.Errorf("malformed or_address port in %q: %w", addr, err)
+			continue
+		}
+		return ip, port, nil
+	}
+	return "", 0, lastErr
+}
+
+// summarizeExitPolicy flattens Onionoo's exit_policy_summary (a single
+// "accept"/"reject" key mapped to a port list) into one string, e.g.
+// "accept 80,443".
+func summarizeExitPolicy(summary map[string][]string) string {
+	for _, action := range []string{"accept", "reject"} {
+		if ports, ok := summary[action]; ok {
+			return fmt.Sprintf("%s %s", action, strings.Join(ports, ","))
+		}
+	}
+	return ""
+}
@@ -0,0 +1,145 @@
+// Package policy evaluates Tor relay exit policies: ordered accept/reject
+// rules over a destination CIDR and port range, first match wins, and a
+// default action for everything no rule matches.
+package policy
+
+import (
+	"fmt"
+	"net/netip"
+	"strconv"
+	"strings"
+)
+
+// Rule is a single accept/reject line of an exit policy.
+type Rule struct {
+	Accept   bool
+	Network  netip.Prefix
+	PortLow  int
+	PortHigh int
+}
+
+// Matches reports whether the rule covers a connection to ip:port.
+func (r Rule) Matches(ip netip.Addr, port int) bool {
+	return r.Network.Contains(ip) && port >= r.PortLow && port <= r.PortHigh
+}
+
+// Allows evaluates the rule list in order and returns whether a connection to
+// ip:port would be permitted. If no rule matches, defaultAccept is returned —
+// see Parse for how that's derived.
+func Allows(rules []Rule, defaultAccept bool, ip netip.Addr, port int) bool {
+	for _, r := range rules {
+		if r.Matches(ip, port) {
+			return r.Accept
+		}
+	}
+	return defaultAccept
+}
+
+// Parse turns a summary such as "accept 80,443,8080-8090" or a fuller form
+// such as "reject 10.0.0.0/8:*" into a rule list, along with the default
+// action for any ip:port none of the rules match. The summary holds one
+// action followed by one comma-separated clause list (input with more than
+// one action, such as a multi-line policy, is rejected as malformed); each
+// clause becomes one rule, and a clause with no explicit network applies to
+// 0.0.0.0/0 (i.e. Onionoo's port-only exit policy summaries).
+//
+// Onionoo's exit_policy_summary is always the shorter of the accept/reject
+// list for *all* ports, so a port-only summary means the listed ports get
+// this rule's action and every other port gets the opposite one — e.g.
+// "reject 25,119" accepts everything except 25 and 119. A clause with an
+// explicit network (the fuller, per-line directory-consensus form) is
+// assumed to end in its own catch-all rule, so its default is the
+// conventional reject.
+func Parse(summary string) ([]Rule, bool, error) {
+	summary = strings.TrimSpace(summary)
+	if summary == "" {
+		return nil, false, nil
+	}
+
+	fields := strings.Fields(summary)
+	if len(fields) != 2 {
+		return nil, false, fmt.Errorf("malformed exit policy summary %q", summary)
+	}
+
+	accept := false
+	switch fields[0] {
+	case "accept":
+		accept = true
+	case "reject":
+		accept = false
+	default:
+		return nil, false, fmt.Errorf("unknown exit policy action %q", fields[0])
+	}
+
+	var rules []Rule
+	portOnly := true
+	for _, clause := range strings.Split(fields[1], ",") {
+		network, ports, explicitNetwork, err := splitClause(clause)
+		if err != nil {
+			return nil, false, err
+		}
+		if explicitNetwork {
+			portOnly = false
+		}
+		low, high, err := parsePortRange(ports)
+		if err != nil {
+			return nil, false, err
+		}
+		rules = append(rules, Rule{Accept: accept, Network: network, PortLow: low, PortHigh: high})
+	}
+
+	defaultAccept := portOnly && !accept
+	return rules, defaultAccept, nil
+}
+
+// splitClause pulls an optional "network:" prefix off a port clause,
+// defaulting to the all-addresses prefix when none is present. The bool
+// result reports whether an explicit network was present, which Parse uses
+// to tell a port-only summary from the fuller per-network form.
+func splitClause(clause string) (netip.Prefix, string, bool, error) {
+	if idx := strings.LastIndex(clause, ":"); idx != -1 && strings.ContainsAny(clause[:idx], "./") {
+		network, err := parseNetwork(clause[:idx])
+		if err != nil {
+			return netip.Prefix{}, "", false, err
+		}
+		return network, clause[idx+1:], true, nil
+	}
+	return netip.MustParsePrefix("0.0.0.0/0"), clause, false, nil
+}
+
+func parseNetwork(s string) (netip.Prefix, error) {
+	if strings.Contains(s, "/") {
+		return netip.ParsePrefix(s)
+	}
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("invalid network %q: %w", s, err)
+	}
+	bits := 32
+	if addr.Is6() {
+		bits = 128
+	}
+	return netip.PrefixFrom(addr, bits), nil
+}
+
+func parsePortRange(s string) (int, int, error) {
+	if s == "*" {
+		return 0, 65535, nil
+	}
+	if lo, hi, ok := strings.Cut(s, "-"); ok {
+		low, err := strconv.Atoi(lo)
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid port range %q: %w", s, err)
+		}
+		high, err := strconv.Atoi(hi)
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid port range %q: %w", s, err)
+		}
+		return low, high, nil
+	}
+	port, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid port %q: %w", s, err)
+	}
+	return port, port, nil
+}
@@ -0,0 +1,89 @@
+package policy
+
+import (
+	"net/netip"
+	"testing"
+)
+
+func TestParseAndAllows(t *testing.T) {
+	cases := []struct {
+		name    string
+		summary string
+		ip      string
+		port    int
+		want    bool
+	}{
+		{
+			name:    "accept summary allows a listed port",
+			summary: "accept 80,443",
+			ip:      "1.2.3.4",
+			port:    443,
+			want:    true,
+		},
+		{
+			name:    "accept summary rejects an unlisted port",
+			summary: "accept 80,443",
+			ip:      "1.2.3.4",
+			port:    22,
+			want:    false,
+		},
+		{
+			name:    "reject summary rejects a listed port",
+			summary: "reject 25,119",
+			ip:      "1.2.3.4",
+			port:    25,
+			want:    false,
+		},
+		{
+			name:    "reject summary defaults to accept for an unlisted port",
+			summary: "reject 25,119",
+			ip:      "1.2.3.4",
+			port:    80,
+			want:    true,
+		},
+		{
+			name:    "port range is inclusive",
+			summary: "accept 8080-8090",
+			ip:      "1.2.3.4",
+			port:    8090,
+			want:    true,
+		},
+		{
+			name:    "explicit network defaults to reject outside its rules",
+			summary: "reject 10.0.0.0/8:*",
+			ip:      "8.8.8.8",
+			port:    80,
+			want:    false,
+		},
+		{
+			name:    "explicit network rule still applies to matching addresses",
+			summary: "reject 10.0.0.0/8:*",
+			ip:      "10.1.2.3",
+			port:    80,
+			want:    false,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			rules, defaultAccept, err := Parse(tc.summary)
+			if err != nil {
+				t.Fatalf("Parse(%q) returned error: %v", tc.summary, err)
+			}
+			addr := netip.MustParseAddr(tc.ip)
+			got := Allows(rules, defaultAccept, addr, tc.port)
+			if got != tc.want {
+				t.Errorf("Allows(%q, %s:%d) = %v, want %v", tc.summary, tc.ip, tc.port, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestParseRejectsMalformedSummary(t *testing.T) {
+	if _, _, err := Parse("accept"); err == nil {
+		t.Fatal("expected error for a summary with no port list")
+	}
+	if _, _, err := Parse("allow 80"); err == nil {
+		t.Fatal("expected error for an unknown action")
+	}
+}
@@ -0,0 +1,111 @@
+// Package retention implements an InfluxDB-style retention policy: rows
+// older than a configurable TTL are periodically swept off of a table,
+// keyed by a "last_seen" column.
+package retention
+
+import (
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Policy controls how aggressively stale rows are expired.
+type Policy struct {
+	// TTL is how long a row may go unseen before it's eligible for expiry.
+	TTL time.Duration
+	// SweepInterval is how often the background sweep runs.
+	SweepInterval time.Duration
+	// HardDelete removes rows outright. When false, rows are soft-deleted
+	// (gorm's DeletedAt convention) so they can still be inspected/restored.
+	HardDelete bool
+}
+
+// Manager runs a background sweep of a table on its own ticker, expiring
+// rows whose last_seen has fallen outside the current policy's TTL.
+type Manager struct {
+	db    *gorm.DB
+	model interface{}
+
+	mu     sync.RWMutex
+	policy Policy
+	ticker *time.Ticker
+	stopCh chan struct{}
+}
+
+// NewManager builds a Manager for the given model, a pointer to a gorm
+// model struct with a "LastSeen time.Time" field.
+func NewManager(db *gorm.DB, model interface{}, policy Policy) *Manager {
+	return &Manager{db: db, model: model, policy: policy}
+}
+
+// Start launches the background sweep goroutine. It is a no-op if already
+// running.
+func (m *Manager) Start() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.ticker != nil {
+		return
+	}
+	m.ticker = time.NewTicker(m.policy.SweepInterval)
+	m.stopCh = make(chan struct{})
+	ticker, stopCh := m.ticker, m.stopCh
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				m.Sweep()
+			case <-stopCh:
+				return
+			}
+		}
+	}()
+}
+
+// Stop halts the background sweep goroutine.
+func (m *Manager) Stop() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.ticker == nil {
+		return
+	}
+	m.ticker.Stop()
+	close(m.stopCh)
+	m.ticker = nil
+}
+
+// Policy returns the manager's current policy.
+func (m *Manager) Policy() Policy {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.policy
+}
+
+// SetPolicy updates the policy at runtime. If the sweep is running, it's
+// restarted so the new interval takes effect immediately.
+func (m *Manager) SetPolicy(p Policy) {
+	m.mu.Lock()
+	running := m.ticker != nil
+	if running {
+		m.ticker.Stop()
+		close(m.stopCh)
+		m.ticker = nil
+	}
+	m.policy = p
+	m.mu.Unlock()
+	if running {
+		m.Start()
+	}
+}
+
+// Sweep runs one expiry pass immediately.
+func (m *Manager) Sweep() error {
+	policy := m.Policy()
+	cutoff := time.Now().Add(-policy.TTL)
+
+	tx := m.db.Where("last_seen < ?", cutoff)
+	if policy.HardDelete {
+		tx = tx.Unscoped()
+	}
+	return tx.Delete(m.model).Error
+}
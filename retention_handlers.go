@@ -0,0 +1,54 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/vbha/tor-exit-nodes/retention"
+)
+
+// retentionPolicyJSON is the wire representation of a retention.Policy;
+// durations are accepted/returned as strings like "24h" rather than
+// nanoseconds.
+type retentionPolicyJSON struct {
+	TTL           string `json:"ttl"`
+	SweepInterval string `json:"sweep_interval"`
+	HardDelete    bool   `json:"hard_delete"`
+}
+
+func getRetentionPolicy(c *gin.Context) {
+	policy := retentionManager.Policy()
+	c.JSON(http.StatusOK, retentionPolicyJSON{
+		TTL:           policy.TTL.String(),
+		SweepInterval: policy.SweepInterval.String(),
+		HardDelete:    policy.HardDelete,
+	})
+}
+
+func updateRetentionPolicy(c *gin.Context) {
+	var req retentionPolicyJSON
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ttl, err := time.ParseDuration(req.TTL)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ttl duration"})
+		return
+	}
+	sweepInterval, err := time.ParseDuration(req.SweepInterval)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid sweep_interval duration"})
+		return
+	}
+
+	retentionManager.SetPolicy(retention.Policy{
+		TTL:           ttl,
+		SweepInterval: sweepInterval,
+		HardDelete:    req.HardDelete,
+	})
+	c.JSON(http.StatusOK, req)
+}
@@ -0,0 +1,106 @@
+// Package torclient provides an *http.Client that routes requests over Tor,
+// either via an external SOCKS5 proxy or an embedded Tor process, so the
+// server doesn't have to leak "I consume Tor metadata" to the clearnet.
+package torclient
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/cretz/bine/tor"
+	"github.com/ipsn/go-libtor"
+	"golang.org/x/net/proxy"
+)
+
+// Config controls how Provider builds its client.
+type Config struct {
+	// ViaTor enables routing through Tor at all; if false, Client always
+	// returns http.DefaultClient.
+	ViaTor bool
+	// SocksAddr, if set, points at an already-running SOCKS5 proxy
+	// (typically a system Tor daemon) instead of embedding one.
+	SocksAddr string
+	// BootstrapTimeout bounds how long the embedded Tor process gets to
+	// bootstrap before Client falls back to direct HTTP.
+	BootstrapTimeout time.Duration
+}
+
+// Provider builds the configured client on each call to Client; only the
+// embedded Tor instance is started lazily and kept. go-libtor only
+// supports one embedded Tor process per executable, so the embedded
+// instance is started at most once regardless of how many callers ask for
+// it concurrently.
+type Provider struct {
+	cfg Config
+
+	once        sync.Once
+	torInstance *tor.Tor
+	torErr      error
+}
+
+// New builds a Provider from cfg. It does nothing until Client or Get is
+// called.
+func New(cfg Config) *Provider {
+	return &Provider{cfg: cfg}
+}
+
+// Client returns an *http.Client wired to use Tor per the provider's
+// config, falling back to a direct client (with a logged warning) if
+// embedded bootstrap fails or times out.
+func (p *Provider) Client(ctx context.Context) (*http.Client, error) {
+	if !p.cfg.ViaTor {
+		return http.DefaultClient, nil
+	}
+	if p.cfg.SocksAddr != "" {
+		return socksClient(p.cfg.SocksAddr)
+	}
+	return p.embeddedClient(ctx)
+}
+
+// Get lazily starts the embedded Tor instance and returns it, safe for
+// concurrent callers: the process is started exactly once.
+func (p *Provider) Get(ctx context.Context) (*tor.Tor, error) {
+	p.once.Do(func() {
+		p.torInstance, p.torErr = tor.Start(ctx, &tor.StartConf{ProcessCreator: libtor.Creator})
+	})
+	return p.torInstance, p.torErr
+}
+
+func (p *Provider) embeddedClient(ctx context.Context) (*http.Client, error) {
+	timeout := p.cfg.BootstrapTimeout
+	if timeout <= 0 {
+		timeout = 2 * time.Minute
+	}
+	bootstrapCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	t, err := p.Get(bootstrapCtx)
+	if err != nil {
+		log.Printf("torclient: embedded Tor bootstrap failed, falling back to direct HTTP: %v", err)
+		return http.DefaultClient, nil
+	}
+
+	dialer, err := t.Dialer(bootstrapCtx, nil)
+	if err != nil {
+		log.Printf("torclient: building Tor dialer failed, falling back to direct HTTP: %v", err)
+		return http.DefaultClient, nil
+	}
+
+	return &http.Client{Transport: &http.Transport{DialContext: dialer.DialContext}}, nil
+}
+
+func socksClient(addr string) (*http.Client, error) {
+	dialer, err := proxy.SOCKS5("tcp", addr, nil, proxy.Direct)
+	if err != nil {
+		return nil, fmt.Errorf("dialing SOCKS5 proxy %q: %w", addr, err)
+	}
+	contextDialer, ok := dialer.(proxy.ContextDialer)
+	if !ok {
+		return nil, fmt.Errorf("SOCKS5 dialer for %q doesn't support contexts", addr)
+	}
+	return &http.Client{Transport: &http.Transport{DialContext: contextDialer.DialContext}}, nil
+}
@@ -0,0 +1,104 @@
+// Package workerpool provides a small bounded worker pool for fan-out work
+// like per-IP enrichment, shared across the fetch pipeline and any future
+// scanners that need to submit jobs.
+package workerpool
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+)
+
+// Job is a unit of work submitted to a Pool. It receives the pool's
+// lifetime context so long-running work can observe cancellation.
+type Job func(ctx context.Context)
+
+// Pool runs submitted jobs across a fixed number of worker goroutines
+// draining a shared, buffered queue.
+type Pool struct {
+	jobs    chan Job
+	workers int
+	depth   int64
+	wg      sync.WaitGroup
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+// New creates a pool with the given worker count and queue capacity. Call
+// Start to launch the workers.
+func New(workers, queueSize int) *Pool {
+	return &Pool{
+		jobs:    make(chan Job, queueSize),
+		workers: workers,
+	}
+}
+
+// Start launches the worker goroutines. They run until ctx is cancelled or
+// the pool is shut down.
+func (p *Pool) Start(ctx context.Context) {
+	for i := 0; i < p.workers; i++ {
+		p.wg.Add(1)
+		go p.run(ctx)
+	}
+}
+
+func (p *Pool) run(ctx context.Context) {
+	defer p.wg.Done()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case job, ok := <-p.jobs:
+			if !ok {
+				return
+			}
+			atomic.AddInt64(&p.depth, -1)
+			job(ctx)
+		}
+	}
+}
+
+// Submit queues a job for a worker to pick up. It blocks if the queue is
+// full, and returns false without queuing the job if the pool has already
+// been shut down.
+func (p *Pool) Submit(job Job) bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.closed {
+		return false
+	}
+	atomic.AddInt64(&p.depth, 1)
+	p.jobs <- job
+	return true
+}
+
+// QueueDepth reports how many submitted jobs are still waiting for a
+// worker.
+func (p *Pool) QueueDepth() int {
+	return int(atomic.LoadInt64(&p.depth))
+}
+
+// Saturated reports whether the queue is currently full, i.e. the next
+// Submit would block.
+func (p *Pool) Saturated() bool {
+	return p.QueueDepth() >= cap(p.jobs)
+}
+
+// Shutdown closes the job queue and waits for in-flight and queued jobs to
+// drain (or for the pool's context to be cancelled, which stops workers
+// immediately instead). It's safe to call more than once, and any Submit
+// racing with it either completes before the close or is rejected cleanly
+// rather than panicking on a send to a closed channel.
+func (p *Pool) Shutdown() {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return
+	}
+	p.closed = true
+	close(p.jobs)
+	p.mu.Unlock()
+
+	p.wg.Wait()
+}